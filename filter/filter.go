@@ -0,0 +1,414 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package filter implements a small expression language for selecting or
+// rejecting files based on the fields returned by the statx(2) syscall.
+//
+// An expression has the form
+//
+//	[!]field comparator value
+//
+// where field is one of the statx field names (size, blocks, nlink, uid,
+// gid, mode, type, atime, mtime, ctime, btime, attrs, ino, dev, blksize),
+// comparator is one of =, !=, <, <=, >, >=, ~ (regex match) or & (bitmask
+// match, only valid for mode and attrs), and value is parsed according to
+// field. A leading ! negates the whole expression; this is the same
+// per-expression negation the command line calls "-not", spelled as a
+// prefix on the expression string itself rather than a separate flag,
+// since -filter is already repeatable and each occurrence needs its own
+// independent negation.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Comparator is the relational operator of a parsed expression.
+type Comparator int
+
+// Supported comparators.
+const (
+	Eq Comparator = iota
+	Ne
+	Lt
+	Le
+	Gt
+	Ge
+	Regex
+	Mask
+)
+
+func (c Comparator) String() string {
+	switch c {
+	case Eq:
+		return "="
+	case Ne:
+		return "!="
+	case Lt:
+		return "<"
+	case Le:
+		return "<="
+	case Gt:
+		return ">"
+	case Ge:
+		return ">="
+	case Regex:
+		return "~"
+	case Mask:
+		return "&"
+	default:
+		return "?"
+	}
+}
+
+var comparators = []struct {
+	tok string
+	cmp Comparator
+}{
+	// longer tokens first so "!=" isn't matched by "="
+	{"!=", Ne},
+	{"<=", Le},
+	{">=", Ge},
+	{"=", Eq},
+	{"<", Lt},
+	{">", Gt},
+	{"~", Regex},
+	{"&", Mask},
+}
+
+var fileTypes = map[string]uint32{
+	"fifo":    unix.S_IFIFO,
+	"chr":     unix.S_IFCHR,
+	"char":    unix.S_IFCHR,
+	"dir":     unix.S_IFDIR,
+	"blk":     unix.S_IFBLK,
+	"block":   unix.S_IFBLK,
+	"regular": unix.S_IFREG,
+	"file":    unix.S_IFREG,
+	"symlink": unix.S_IFLNK,
+	"link":    unix.S_IFLNK,
+	"socket":  unix.S_IFSOCK,
+	"sock":    unix.S_IFSOCK,
+}
+
+var attrNames = map[string]uint64{
+	"compressed": unix.STATX_ATTR_COMPRESSED,
+	"immutable":  unix.STATX_ATTR_IMMUTABLE,
+	"append":     unix.STATX_ATTR_APPEND,
+	"nodump":     unix.STATX_ATTR_NODUMP,
+	"encrypted":  unix.STATX_ATTR_ENCRYPTED,
+	"verity":     unix.STATX_ATTR_VERITY,
+	"dax":        unix.STATX_ATTR_DAX,
+	"mount_root": unix.STATX_ATTR_MOUNT_ROOT,
+	"automount":  unix.STATX_ATTR_AUTOMOUNT,
+}
+
+// fields whose availability depends on a STATX_* bit in statx.Mask. Of the
+// fields not listed here, dev and blksize are always available and attrs
+// depends on statx.Attributes_mask instead.
+var fieldMaskBits = map[string]uint32{
+	"size":   unix.STATX_SIZE,
+	"blocks": unix.STATX_BLOCKS,
+	"nlink":  unix.STATX_NLINK,
+	"uid":    unix.STATX_UID,
+	"gid":    unix.STATX_GID,
+	"mode":   unix.STATX_MODE,
+	"type":   unix.STATX_TYPE,
+	"atime":  unix.STATX_ATIME,
+	"mtime":  unix.STATX_MTIME,
+	"ctime":  unix.STATX_CTIME,
+	"btime":  unix.STATX_BTIME,
+	"ino":    unix.STATX_INO,
+}
+
+// Predicate is a parsed filter expression that can be evaluated against a
+// unix.Statx_t.
+type Predicate struct {
+	negate bool
+	field  string
+	cmp    Comparator
+	num    uint64
+	re     *regexp.Regexp
+}
+
+// Parse parses a single filter expression such as "size>1M" or
+// "!attrs&compressed" into a Predicate.
+func Parse(expr string) (Predicate, error) {
+	var p Predicate
+
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "!") {
+		p.negate = true
+		expr = expr[1:]
+	}
+
+	field, rest, cmp, err := splitExpr(expr)
+	if err != nil {
+		return Predicate{}, err
+	}
+	p.field = field
+	p.cmp = cmp
+
+	if _, ok := fieldMaskBits[field]; !ok {
+		switch field {
+		case "dev", "blksize", "attrs":
+		default:
+			return Predicate{}, fmt.Errorf("filter: unknown field %q", field)
+		}
+	}
+
+	if cmp == Mask && field != "mode" && field != "attrs" {
+		return Predicate{}, fmt.Errorf("filter: comparator %q is only valid for mode and attrs, not %q", cmp, field)
+	}
+
+	if cmp == Regex {
+		re, err := regexp.Compile(rest)
+		if err != nil {
+			return Predicate{}, fmt.Errorf("filter: invalid regex %q: %v", rest, err)
+		}
+		p.re = re
+		return p, nil
+	}
+
+	num, err := parseValue(field, cmp, rest)
+	if err != nil {
+		return Predicate{}, err
+	}
+	p.num = num
+
+	return p, nil
+}
+
+func splitExpr(expr string) (field, value string, cmp Comparator, err error) {
+	bestIdx := -1
+	var best struct {
+		tok string
+		cmp Comparator
+	}
+	for _, c := range comparators {
+		i := strings.Index(expr, c.tok)
+		if i < 0 {
+			continue
+		}
+		// Prefer the earliest-positioned token; on a tie (e.g. "!=" and "="
+		// both start at the same index) prefer the longer one.
+		if bestIdx < 0 || i < bestIdx || (i == bestIdx && len(c.tok) > len(best.tok)) {
+			bestIdx = i
+			best.tok = c.tok
+			best.cmp = c.cmp
+		}
+	}
+	if bestIdx < 0 {
+		return "", "", 0, fmt.Errorf("filter: no comparator found in expression %q", expr)
+	}
+	field = strings.ToLower(strings.TrimSpace(expr[:bestIdx]))
+	value = strings.TrimSpace(expr[bestIdx+len(best.tok):])
+	return field, value, best.cmp, nil
+}
+
+func parseValue(field string, cmp Comparator, s string) (uint64, error) {
+	switch field {
+	case "size":
+		return parseSize(s)
+	case "atime", "mtime", "ctime", "btime":
+		return parseTime(s)
+	case "mode":
+		v, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("filter: invalid octal mode %q: %v", s, err)
+		}
+		return v, nil
+	case "type":
+		t, ok := fileTypes[strings.ToLower(s)]
+		if !ok {
+			return 0, fmt.Errorf("filter: unknown file type %q", s)
+		}
+		return uint64(t), nil
+	case "attrs":
+		if cmp == Mask {
+			var v uint64
+			for _, name := range strings.Split(s, ",") {
+				bit, ok := attrNames[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					return 0, fmt.Errorf("filter: unknown attribute %q", name)
+				}
+				v |= bit
+			}
+			return v, nil
+		}
+		return strconv.ParseUint(s, 0, 64)
+	default:
+		return strconv.ParseUint(s, 0, 64)
+	}
+}
+
+func parseSize(s string) (uint64, error) {
+	mult := uint64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			mult = 1 << 10
+			s = s[:n-1]
+		case 'm', 'M':
+			mult = 1 << 20
+			s = s[:n-1]
+		case 'g', 'G':
+			mult = 1 << 30
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("filter: invalid size %q: %v", s, err)
+	}
+	return v * mult, nil
+}
+
+func parseTime(s string) (uint64, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return uint64(t.Unix()), nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, fmt.Errorf("filter: invalid time %q, want RFC3339 or YYYY-MM-DD", s)
+	}
+	return uint64(t.Unix()), nil
+}
+
+// Eval evaluates the predicate against statx. If the field required by the
+// predicate is not present in statx.Mask (and, for attrs, not present in
+// statx.Attributes_mask), Eval returns false rather than reporting an error,
+// so the caller can simply skip the file instead of aborting.
+func (p Predicate) Eval(statx *unix.Statx_t) bool {
+	if bit, ok := fieldMaskBits[p.field]; ok && statx.Mask&bit == 0 {
+		return false
+	}
+
+	var match bool
+	switch p.field {
+	case "mode":
+		if p.cmp == Mask {
+			match = uint64(statx.Mode&07777)&p.num != 0
+		} else if p.cmp == Regex {
+			match = p.re.MatchString(fmt.Sprintf("%04o", statx.Mode&07777))
+		} else {
+			match = compare(uint64(statx.Mode&07777), p.cmp, p.num)
+		}
+	case "attrs":
+		if statx.Attributes_mask == 0 {
+			return false
+		}
+		if p.cmp == Mask {
+			if statx.Attributes_mask&p.num == 0 {
+				return false
+			}
+			match = statx.Attributes&p.num != 0
+		} else if p.cmp == Regex {
+			match = p.re.MatchString(fmt.Sprintf("%#x", statx.Attributes))
+		} else {
+			match = compare(statx.Attributes, p.cmp, p.num)
+		}
+	case "type":
+		v := uint64(statx.Mode & unix.S_IFMT)
+		if p.cmp == Regex {
+			match = p.re.MatchString(typeName(uint32(v)))
+		} else {
+			match = compare(v, p.cmp, p.num)
+		}
+	default:
+		v := fieldValue(statx, p.field)
+		if p.cmp == Regex {
+			match = p.re.MatchString(fmt.Sprint(v))
+		} else {
+			match = compare(v, p.cmp, p.num)
+		}
+	}
+
+	if p.negate {
+		match = !match
+	}
+	return match
+}
+
+func fieldValue(statx *unix.Statx_t, field string) uint64 {
+	switch field {
+	case "size":
+		return statx.Size
+	case "blocks":
+		return uint64(statx.Blocks)
+	case "nlink":
+		return uint64(statx.Nlink)
+	case "uid":
+		return uint64(statx.Uid)
+	case "gid":
+		return uint64(statx.Gid)
+	case "atime":
+		return uint64(statx.Atime.Sec)
+	case "mtime":
+		return uint64(statx.Mtime.Sec)
+	case "ctime":
+		return uint64(statx.Ctime.Sec)
+	case "btime":
+		return uint64(statx.Btime.Sec)
+	case "ino":
+		return statx.Ino
+	case "dev":
+		return uint64(unix.Mkdev(statx.Dev_major, statx.Dev_minor))
+	case "blksize":
+		return uint64(statx.Blksize)
+	default:
+		return 0
+	}
+}
+
+// typeName returns the canonical name for mode's file type, i.e. the same
+// name parseValue accepts for "type=...". fileTypes maps more than one name
+// to some bits (e.g. "regular" and "file" both mean S_IFREG), so this can't
+// just range over the map: that would make "type~..." match a different,
+// randomly chosen alias on every run.
+func typeName(mode uint32) string {
+	switch mode {
+	case unix.S_IFIFO:
+		return "fifo"
+	case unix.S_IFCHR:
+		return "chr"
+	case unix.S_IFDIR:
+		return "dir"
+	case unix.S_IFBLK:
+		return "blk"
+	case unix.S_IFREG:
+		return "regular"
+	case unix.S_IFLNK:
+		return "symlink"
+	case unix.S_IFSOCK:
+		return "socket"
+	default:
+		return "unknown"
+	}
+}
+
+func compare(v uint64, cmp Comparator, want uint64) bool {
+	switch cmp {
+	case Eq:
+		return v == want
+	case Ne:
+		return v != want
+	case Lt:
+		return v < want
+	case Le:
+		return v <= want
+	case Gt:
+		return v > want
+	case Ge:
+		return v >= want
+	default:
+		return false
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func testStatx() *unix.Statx_t {
+	return &unix.Statx_t{
+		Mask:            unix.STATX_ALL,
+		Size:            2 * 1024 * 1024,
+		Blocks:          10,
+		Blksize:         4096,
+		Nlink:           2,
+		Uid:             1000,
+		Gid:             1000,
+		Mode:            unix.S_IFREG | 0644,
+		Ino:             42,
+		Dev_major:       8,
+		Dev_minor:       1,
+		Attributes_mask: unix.STATX_ATTR_COMPRESSED | unix.STATX_ATTR_IMMUTABLE,
+		Attributes:      unix.STATX_ATTR_COMPRESSED,
+		Atime:           unix.StatxTimestamp{Sec: mustUnix("2020-06-15T00:00:00Z")},
+		Mtime:           unix.StatxTimestamp{Sec: mustUnix("2020-06-15T00:00:00Z")},
+		Ctime:           unix.StatxTimestamp{Sec: mustUnix("2020-06-15T00:00:00Z")},
+		Btime:           unix.StatxTimestamp{Sec: mustUnix("2019-01-01T00:00:00Z")},
+	}
+}
+
+func mustUnix(s string) int64 {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t.Unix()
+}
+
+func TestParseAndEval(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"size eq", "size=2097152", true},
+		{"size eq suffix M", "size=2M", true},
+		{"size gt suffix K", "size>1024K", true},
+		{"size lt", "size<1M", false},
+		{"size ne", "size!=1M", true},
+		{"size ge", "size>=2M", true},
+		{"size le", "size<=2M", true},
+		{"blocks gt", "blocks>5", true},
+		{"nlink eq", "nlink=2", true},
+		{"uid eq", "uid=1000", true},
+		{"gid ne", "gid!=1000", false},
+		{"ino eq", "ino=42", true},
+		{"blksize eq", "blksize=4096", true},
+		{"mode eq", "mode=0644", true},
+		{"mode eq no match", "mode=0755", false},
+		{"mode mask match", "mode&0600", true},
+		{"mode mask no match", "mode&0100", false},
+		{"mode regex", "mode~0644", true},
+		{"type eq regular", "type=regular", true},
+		{"type eq dir", "type=dir", false},
+		{"type regex", "type~regular", true},
+		{"attrs mask single", "attrs&compressed", true},
+		{"attrs mask unset", "attrs&immutable", false},
+		{"attrs mask multi matches any", "attrs&compressed,immutable", true},
+		{"attrs mask newer attribute names", "attrs&verity,dax,mount_root,automount", false},
+		{"atime eq rfc3339", "atime=2020-06-15T00:00:00Z", true},
+		{"mtime eq date", "mtime=2020-06-15", true},
+		{"btime lt", "btime<2020-01-01", true},
+		{"ctime gt", "ctime>2019-01-01", true},
+		{"negate size", "!size=2M", false},
+		{"negate mode mask", "!mode&0100", true},
+		{"leading/trailing space", "  size > 1M  ", true},
+		{"uppercase field", "SIZE>1M", true},
+	}
+
+	statx := testStatx()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.expr, err)
+			}
+			if got := p.Eval(statx); got != tt.want {
+				t.Errorf("Parse(%q).Eval() = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevField(t *testing.T) {
+	statx := testStatx()
+	dev := unix.Mkdev(statx.Dev_major, statx.Dev_minor)
+
+	p, err := Parse(fmt.Sprintf("dev=%d", dev))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !p.Eval(statx) {
+		t.Errorf("Eval() = false, want true for dev=%d", dev)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"nosuchfield=1",
+		"type=notatype",
+		"mode=notoctal",
+		"attrs&notanattr",
+		"size~[invalid(",
+		"atime=not-a-time",
+		"justafield",
+		"size&100",
+		"type&7",
+		"uid&1",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Parse(expr); err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
+
+func TestEvalMissingMaskBit(t *testing.T) {
+	statx := testStatx()
+	statx.Mask &^= unix.STATX_SIZE
+
+	p, err := Parse("size>0")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if p.Eval(statx) {
+		t.Errorf("Eval() = true for a field missing from statx.Mask, want false")
+	}
+}
+
+func TestSplitExprEarliestComparator(t *testing.T) {
+	statx := testStatx()
+	statx.Mode = unix.S_IFREG | 0644
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"type~^regular=x$", false}, // literal regex, doesn't match the type name
+		{"mode~^0?644$", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+			}
+			if got := p.Eval(statx); got != tt.want {
+				t.Errorf("Parse(%q).Eval() = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+
+	p, err := Parse(`type~^regular=x$`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if p.field != "type" || p.cmp != Regex {
+		t.Errorf("Parse(%q) = field %q cmp %v, want field \"type\" cmp Regex", `type~^regular=x$`, p.field, p.cmp)
+	}
+}
+
+func TestEvalAttrsMaskAbsent(t *testing.T) {
+	statx := testStatx()
+	statx.Attributes_mask = 0
+	statx.Attributes = unix.STATX_ATTR_COMPRESSED
+
+	for _, expr := range []string{"attrs=4", "attrs!=0", "attrs~.*"} {
+		p, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", expr, err)
+		}
+		if p.Eval(statx) {
+			t.Errorf("Parse(%q).Eval() = true with Attributes_mask unset, want false", expr)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		v, want uint64
+		cmp     Comparator
+		result  bool
+	}{
+		{5, 5, Eq, true},
+		{5, 6, Eq, false},
+		{5, 6, Ne, true},
+		{5, 6, Lt, true},
+		{5, 5, Le, true},
+		{6, 5, Gt, true},
+		{5, 5, Ge, true},
+	}
+	for _, tt := range tests {
+		if got := compare(tt.v, tt.cmp, tt.want); got != tt.result {
+			t.Errorf("compare(%d, %v, %d) = %v, want %v", tt.v, tt.cmp, tt.want, got, tt.result)
+		}
+	}
+}
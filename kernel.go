@@ -0,0 +1,57 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelVersion is a parsed Linux kernel release, as reported by uname(2),
+// down to the major.minor precision needed to gate statx(2) features.
+type kernelVersion struct {
+	major, minor int
+}
+
+// parseKernelVersion parses the major.minor prefix of a kernel release
+// string such as "5.15.0-91-generic" or "4.11.0".
+func parseKernelVersion(release string) (kernelVersion, error) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return kernelVersion{}, fmt.Errorf("malformed kernel release %q", release)
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return kernelVersion{}, fmt.Errorf("malformed kernel release %q: %v", release, err)
+	}
+	minor, err := strconv.Atoi(strings.SplitN(fields[1], "-", 2)[0])
+	if err != nil {
+		return kernelVersion{}, fmt.Errorf("malformed kernel release %q: %v", release, err)
+	}
+	return kernelVersion{major: major, minor: minor}, nil
+}
+
+// atLeast reports whether v is greater than or equal to major.minor.
+func (v kernelVersion) atLeast(major, minor int) bool {
+	if v.major != major {
+		return v.major > major
+	}
+	return v.minor >= minor
+}
+
+// currentKernelVersion returns the running kernel's version, as reported by
+// the uname(2) syscall.
+func currentKernelVersion() (kernelVersion, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return kernelVersion{}, err
+	}
+	return parseKernelVersion(unix.ByteSliceToString(uts.Release[:]))
+}
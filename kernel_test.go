@@ -0,0 +1,67 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import "testing"
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := []struct {
+		release string
+		want    kernelVersion
+		wantErr bool
+	}{
+		{"5.15.0-91-generic", kernelVersion{5, 15}, false},
+		{"4.11.0", kernelVersion{4, 11}, false},
+		{"4.4.0", kernelVersion{4, 4}, false},
+		{"6.1.0-17-amd64", kernelVersion{6, 1}, false},
+		{"not-a-version", kernelVersion{}, true},
+		{"5", kernelVersion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release, func(t *testing.T) {
+			got, err := parseKernelVersion(tt.release)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKernelVersion(%q) error = %v, wantErr %v", tt.release, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseKernelVersion(%q) = %+v, want %+v", tt.release, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		v           kernelVersion
+		major       int
+		minor       int
+		wantAtLeast bool
+	}{
+		{kernelVersion{4, 11}, 4, 11, true},
+		{kernelVersion{4, 12}, 4, 11, true},
+		{kernelVersion{5, 0}, 4, 11, true},
+		{kernelVersion{4, 10}, 4, 11, false},
+		{kernelVersion{3, 19}, 4, 11, false},
+		{kernelVersion{5, 8}, 5, 8, true},
+		{kernelVersion{5, 7}, 5, 8, false},
+	}
+	for _, tt := range tests {
+		if got := tt.v.atLeast(tt.major, tt.minor); got != tt.wantAtLeast {
+			t.Errorf("%+v.atLeast(%d, %d) = %v, want %v", tt.v, tt.major, tt.minor, got, tt.wantAtLeast)
+		}
+	}
+}
+
+func TestCurrentKernelVersion(t *testing.T) {
+	v, err := currentKernelVersion()
+	if err != nil {
+		t.Fatalf("currentKernelVersion() error: %v", err)
+	}
+	if v.major == 0 {
+		t.Errorf("currentKernelVersion() = %+v, want a non-zero major version", v)
+	}
+}
@@ -0,0 +1,477 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package render formats the result of a statx(2) call according to a
+// format string using the directive set of stat(1) from GNU coreutils,
+// plus a few statx-specific extensions. It implements both the
+// -format/-printf flags (Parse and Renderer) and the default output layout
+// (RenderDefault). RenderDefault shares the field helpers of this package
+// (TypeName, SymbolicMode, AttrsString and others) but is not built from a
+// parsed format string.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/user"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Renderer renders statx(2) results according to a parsed format string.
+type Renderer struct {
+	tokens  []token
+	newline bool
+}
+
+type token struct {
+	lit string // literal text; used when dir == 0
+	dir byte   // format directive, e.g. 's' for %s
+}
+
+// directives is the set of supported format directives.
+const directives = "nsbBfaAFhiuUgGdDtTxXyYzZwWCcMmoO"
+
+// Parse parses format into a Renderer. format uses the directive syntax of
+// stat(1): %n name, %s size, %b blocks, %B blksize, %f raw mode (hex), %a
+// octal mode (no leading zeroes, as stat(1) prints it), %A symbolic mode,
+// %F file type, %h nlink, %i inode, %u/%U uid
+// and username, %g/%G gid and groupname, %d/%D device decimal and hex,
+// %t/%T rdev major and minor (hex), %x/%X access time (human/epoch), %y/%Y
+// modify time, %z/%Z change time, %w/%W birth time, plus the statx-specific
+// %C attributes bitmask, %c symbolic attributes string, %M the STATX_* mask
+// bits present in the result, %m mount ID and %o/%O the memory/offset
+// alignment for direct I/O. A literal %% yields a single %. The
+// escapes \n, \t, \\, \0 and \xNN are recognized outside of directives.
+//
+// If newline is true, Render appends a trailing newline, as for -format;
+// -printf passes false and emits none.
+func Parse(format string, newline bool) (*Renderer, error) {
+	var tokens []token
+	var lit bytes.Buffer
+
+	flush := func() {
+		if lit.Len() > 0 {
+			tokens = append(tokens, token{lit: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	r := []rune(format)
+	for i := 0; i < len(r); i++ {
+		switch r[i] {
+		case '%':
+			i++
+			if i >= len(r) {
+				return nil, fmt.Errorf("render: trailing %% in format %q", format)
+			}
+			if r[i] == '%' {
+				lit.WriteByte('%')
+				continue
+			}
+			if !isDirective(byte(r[i])) {
+				return nil, fmt.Errorf("render: unknown directive %%%c", r[i])
+			}
+			flush()
+			tokens = append(tokens, token{dir: byte(r[i])})
+		case '\\':
+			i++
+			if i >= len(r) {
+				return nil, fmt.Errorf("render: trailing backslash in format %q", format)
+			}
+			if err := unescape(&lit, r, &i); err != nil {
+				return nil, err
+			}
+		default:
+			lit.WriteRune(r[i])
+		}
+	}
+	flush()
+
+	return &Renderer{tokens: tokens, newline: newline}, nil
+}
+
+func isDirective(b byte) bool {
+	for i := 0; i < len(directives); i++ {
+		if directives[i] == b {
+			return true
+		}
+	}
+	return false
+}
+
+func unescape(lit *bytes.Buffer, r []rune, i *int) error {
+	switch r[*i] {
+	case 'n':
+		lit.WriteByte('\n')
+	case 't':
+		lit.WriteByte('\t')
+	case '\\':
+		lit.WriteByte('\\')
+	case '0':
+		lit.WriteByte(0)
+	case 'x':
+		if *i+2 >= len(r) {
+			return fmt.Errorf("render: incomplete \\x escape")
+		}
+		b, err := strconv.ParseUint(string(r[*i+1:*i+3]), 16, 8)
+		if err != nil {
+			return fmt.Errorf("render: invalid \\x escape: %v", err)
+		}
+		lit.WriteByte(byte(b))
+		*i += 2
+	default:
+		lit.WriteByte('\\')
+		lit.WriteRune(r[*i])
+	}
+	return nil
+}
+
+// Render writes the formatted result of statx for the file named name to w.
+func (rr *Renderer) Render(w io.Writer, name string, statx *unix.Statx_t) {
+	for _, t := range rr.tokens {
+		if t.dir == 0 {
+			io.WriteString(w, t.lit)
+			continue
+		}
+		writeDirective(w, t.dir, name, statx)
+	}
+	if rr.newline {
+		io.WriteString(w, "\n")
+	}
+}
+
+func writeDirective(w io.Writer, dir byte, name string, statx *unix.Statx_t) {
+	switch dir {
+	case 'n':
+		io.WriteString(w, name)
+	case 's':
+		writeIfMasked(w, statx, unix.STATX_SIZE, func() { fmt.Fprintf(w, "%d", statx.Size) })
+	case 'b':
+		writeIfMasked(w, statx, unix.STATX_BLOCKS, func() { fmt.Fprintf(w, "%d", statx.Blocks) })
+	case 'B':
+		fmt.Fprintf(w, "%d", statx.Blksize)
+	case 'f':
+		writeIfMasked(w, statx, unix.STATX_MODE, func() { fmt.Fprintf(w, "%x", statx.Mode) })
+	case 'a':
+		writeIfMasked(w, statx, unix.STATX_MODE, func() { fmt.Fprintf(w, "%o", statx.Mode&07777) })
+	case 'A':
+		writeIfMasked(w, statx, unix.STATX_MODE, func() { io.WriteString(w, SymbolicMode(statx)) })
+	case 'F':
+		writeIfMasked(w, statx, unix.STATX_TYPE, func() { io.WriteString(w, TypeName(statx.Mode)) })
+	case 'h':
+		writeIfMasked(w, statx, unix.STATX_NLINK, func() { fmt.Fprintf(w, "%d", statx.Nlink) })
+	case 'i':
+		writeIfMasked(w, statx, unix.STATX_INO, func() { fmt.Fprintf(w, "%d", statx.Ino) })
+	case 'u':
+		writeIfMasked(w, statx, unix.STATX_UID, func() { fmt.Fprintf(w, "%d", statx.Uid) })
+	case 'U':
+		writeIfMasked(w, statx, unix.STATX_UID, func() { io.WriteString(w, lookupUser(statx.Uid)) })
+	case 'g':
+		writeIfMasked(w, statx, unix.STATX_GID, func() { fmt.Fprintf(w, "%d", statx.Gid) })
+	case 'G':
+		writeIfMasked(w, statx, unix.STATX_GID, func() { io.WriteString(w, lookupGroup(statx.Gid)) })
+	case 'd':
+		fmt.Fprintf(w, "%d", unix.Mkdev(statx.Dev_major, statx.Dev_minor))
+	case 'D':
+		fmt.Fprintf(w, "%x", unix.Mkdev(statx.Dev_major, statx.Dev_minor))
+	case 't':
+		fmt.Fprintf(w, "%x", statx.Rdev_major)
+	case 'T':
+		fmt.Fprintf(w, "%x", statx.Rdev_minor)
+	case 'x':
+		writeIfMasked(w, statx, unix.STATX_ATIME, func() { fmt.Fprint(w, timestampToTime(statx.Atime)) })
+	case 'X':
+		writeIfMasked(w, statx, unix.STATX_ATIME, func() { fmt.Fprintf(w, "%d", statx.Atime.Sec) })
+	case 'y':
+		writeIfMasked(w, statx, unix.STATX_MTIME, func() { fmt.Fprint(w, timestampToTime(statx.Mtime)) })
+	case 'Y':
+		writeIfMasked(w, statx, unix.STATX_MTIME, func() { fmt.Fprintf(w, "%d", statx.Mtime.Sec) })
+	case 'z':
+		writeIfMasked(w, statx, unix.STATX_CTIME, func() { fmt.Fprint(w, timestampToTime(statx.Ctime)) })
+	case 'Z':
+		writeIfMasked(w, statx, unix.STATX_CTIME, func() { fmt.Fprintf(w, "%d", statx.Ctime.Sec) })
+	case 'w':
+		writeIfMasked(w, statx, unix.STATX_BTIME, func() { fmt.Fprint(w, timestampToTime(statx.Btime)) })
+	case 'W':
+		writeIfMasked(w, statx, unix.STATX_BTIME, func() { fmt.Fprintf(w, "%d", statx.Btime.Sec) })
+	case 'C':
+		fmt.Fprintf(w, "%016x", statx.Attributes)
+	case 'c':
+		io.WriteString(w, AttrsString(statx))
+	case 'M':
+		io.WriteString(w, MaskString(statx.Mask))
+	case 'm':
+		writeIfMasked(w, statx, unix.STATX_MNT_ID, func() { fmt.Fprintf(w, "%d", statx.Mnt_id) })
+	case 'o':
+		writeIfMasked(w, statx, unix.STATX_DIOALIGN, func() { fmt.Fprintf(w, "%d", statx.Dio_mem_align) })
+	case 'O':
+		writeIfMasked(w, statx, unix.STATX_DIOALIGN, func() { fmt.Fprintf(w, "%d", statx.Dio_offset_align) })
+	}
+}
+
+// writeIfMasked calls fn if statx.Mask has bit set, otherwise it writes "?"
+// to indicate the field was not returned by the kernel.
+func writeIfMasked(w io.Writer, statx *unix.Statx_t, bit uint32, fn func()) {
+	if statx.Mask&bit == 0 {
+		io.WriteString(w, "?")
+		return
+	}
+	fn()
+}
+
+func timestampToTime(sts unix.StatxTimestamp) time.Time {
+	return time.Unix(sts.Sec, int64(sts.Nsec))
+}
+
+func lookupUser(uid uint32) string {
+	u, err := user.LookupId(fmt.Sprint(uid))
+	if err != nil {
+		return fmt.Sprint(uid)
+	}
+	return u.Username
+}
+
+func lookupGroup(gid uint32) string {
+	g, err := user.LookupGroupId(fmt.Sprint(gid))
+	if err != nil {
+		return fmt.Sprint(gid)
+	}
+	return g.Name
+}
+
+// TypeLetter returns the single-character type indicator used as the first
+// character of the symbolic mode string, e.g. 'd' for a directory, as in
+// the first column of "ls -l".
+func TypeLetter(mode uint16) byte {
+	switch mode & unix.S_IFMT {
+	case unix.S_IFIFO:
+		return 'p'
+	case unix.S_IFCHR:
+		return 'c'
+	case unix.S_IFDIR:
+		return 'd'
+	case unix.S_IFBLK:
+		return 'b'
+	case unix.S_IFREG:
+		return '-'
+	case unix.S_IFLNK:
+		return 'l'
+	case unix.S_IFSOCK:
+		return 's'
+	default:
+		return '?'
+	}
+}
+
+// TypeName returns the long, human-readable name of the file type, as
+// printed by stat(1), e.g. "regular file" or "symbolic link".
+func TypeName(mode uint16) string {
+	switch mode & unix.S_IFMT {
+	case unix.S_IFIFO:
+		return "FIFO"
+	case unix.S_IFCHR:
+		return "character special file"
+	case unix.S_IFDIR:
+		return "directory"
+	case unix.S_IFBLK:
+		return "block special file"
+	case unix.S_IFREG:
+		return "regular file"
+	case unix.S_IFLNK:
+		return "symbolic link"
+	case unix.S_IFSOCK:
+		return "socket"
+	default:
+		return fmt.Sprintf("unknown type (%o)", mode&unix.S_IFMT)
+	}
+}
+
+// SymbolicMode returns the ls(1)-style symbolic permission string, e.g.
+// "-rwxr-xr-x", including the leading type letter.
+func SymbolicMode(statx *unix.Statx_t) string {
+	rwx := func(r, w, x bool) string {
+		b := []byte{'-', '-', '-'}
+		if r {
+			b[0] = 'r'
+		}
+		if w {
+			b[1] = 'w'
+		}
+		if x {
+			b[2] = 'x'
+		}
+		return string(b)
+	}
+	mode := statx.Mode
+	s := rwx(mode&unix.S_IRUSR != 0, mode&unix.S_IWUSR != 0, mode&unix.S_IXUSR != 0) +
+		rwx(mode&unix.S_IRGRP != 0, mode&unix.S_IWGRP != 0, mode&unix.S_IXGRP != 0) +
+		rwx(mode&unix.S_IROTH != 0, mode&unix.S_IWOTH != 0, mode&unix.S_IXOTH != 0)
+	return string(TypeLetter(mode)) + s
+}
+
+// attrTable maps a single output letter to the STATX_ATTR_* bit it
+// represents, in the order they are printed by AttrsString.
+var attrTable = []struct {
+	letter byte
+	mask   uint64
+}{
+	{'c', unix.STATX_ATTR_COMPRESSED}, // file is compressed by the fs
+	{'i', unix.STATX_ATTR_IMMUTABLE},  // file is marked immutable
+	{'a', unix.STATX_ATTR_APPEND},     // file is append-only
+	{'d', unix.STATX_ATTR_NODUMP},     // file is not to be dumped
+	{'e', unix.STATX_ATTR_ENCRYPTED},  // file requires key to decrypt in fs
+	{'v', unix.STATX_ATTR_VERITY},     // file has fs-verity enabled
+	{'X', unix.STATX_ATTR_DAX},        // file is in the DAX (cpu direct access) state
+	{'r', unix.STATX_ATTR_MOUNT_ROOT}, // file is the root of a mount
+	{'m', unix.STATX_ATTR_AUTOMOUNT},  // dir is an automount trigger
+}
+
+// AttrsString renders statx.Attributes as a fixed-width string with one
+// character per known attribute: the attribute's letter if set, "-" if
+// known but unset, or "." if the kernel did not report that bit in
+// Attributes_mask.
+func AttrsString(statx *unix.Statx_t) string {
+	b := make([]byte, len(attrTable))
+	for i, a := range attrTable {
+		switch {
+		case statx.Attributes_mask&a.mask == 0:
+			b[i] = '.'
+		case statx.Attributes&a.mask != 0:
+			b[i] = a.letter
+		default:
+			b[i] = '-'
+		}
+	}
+	return string(b)
+}
+
+// maskTable maps the symbolic STATX_* mask field names to their bit, in the
+// order MaskString reports them.
+var maskTable = []struct {
+	name string
+	bit  uint32
+}{
+	{"type", unix.STATX_TYPE},
+	{"mode", unix.STATX_MODE},
+	{"nlink", unix.STATX_NLINK},
+	{"uid", unix.STATX_UID},
+	{"gid", unix.STATX_GID},
+	{"atime", unix.STATX_ATIME},
+	{"mtime", unix.STATX_MTIME},
+	{"ctime", unix.STATX_CTIME},
+	{"ino", unix.STATX_INO},
+	{"size", unix.STATX_SIZE},
+	{"blocks", unix.STATX_BLOCKS},
+	{"btime", unix.STATX_BTIME},
+	{"mnt_id", unix.STATX_MNT_ID},
+	{"dioalign", unix.STATX_DIOALIGN},
+}
+
+// MaskString returns a comma-separated list of the symbolic names of the
+// STATX_* bits set in mask.
+func MaskString(mask uint32) string {
+	var buf bytes.Buffer
+	for _, m := range maskTable {
+		if mask&m.bit == 0 {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(m.name)
+	}
+	return buf.String()
+}
+
+// RenderFunc formats the result of a statx(2) call for the file named name
+// and writes it to w. Renderer.Render, as a method value, and RenderDefault
+// both satisfy this signature.
+type RenderFunc func(w io.Writer, name string, statx *unix.Statx_t)
+
+// RenderDefault writes the long, human-readable layout printed when neither
+// -format nor -printf is given. Unlike Render with a format string, it never
+// substitutes a "?" placeholder when the corresponding statx.Mask bit is
+// absent: Size and Blocks keep their label with a blank value, and every
+// other such field is left out together with its label, so that e.g. a filesystem
+// without birth times, mount IDs or direct I/O alignment doesn't produce
+// permanently noisy output.
+func RenderDefault(w io.Writer, name string, statx *unix.Statx_t) {
+	fmt.Fprintf(w, "  File: '%s'\n", name)
+
+	fmt.Fprintf(w, "  Size: ")
+	if statx.Mask&unix.STATX_SIZE != 0 {
+		fmt.Fprintf(w, "%-10d", statx.Size)
+	} else {
+		fmt.Fprintf(w, "%-10s", "")
+	}
+	fmt.Fprintf(w, "\tBlocks: ")
+	if statx.Mask&unix.STATX_BLOCKS != 0 {
+		fmt.Fprintf(w, "%-11d", statx.Blocks)
+	} else {
+		fmt.Fprintf(w, "%-11s", "")
+	}
+	fmt.Fprintf(w, "IO Block: %-6d", statx.Blksize)
+	if statx.Mask&unix.STATX_TYPE != 0 {
+		fmt.Fprintf(w, " %s", TypeName(statx.Mode))
+	}
+	fmt.Fprintln(w)
+
+	isDevice := statx.Mask&unix.STATX_TYPE != 0 && (statx.Mode&unix.S_IFMT == unix.S_IFBLK || statx.Mode&unix.S_IFMT == unix.S_IFCHR)
+
+	fmt.Fprintf(w, "Device: %xh/%dd", unix.Mkdev(statx.Dev_major, statx.Dev_minor), unix.Mkdev(statx.Dev_major, statx.Dev_minor))
+	if statx.Mask&unix.STATX_INO != 0 {
+		fmt.Fprintf(w, "\tInode: %-12d", statx.Ino)
+	}
+	if statx.Mask&unix.STATX_NLINK != 0 {
+		if isDevice {
+			fmt.Fprintf(w, "Links: %-6d", statx.Nlink)
+		} else {
+			fmt.Fprintf(w, "Links: %d", statx.Nlink)
+		}
+	}
+	if isDevice {
+		fmt.Fprintf(w, "Device type: %x,%x", statx.Rdev_major, statx.Rdev_minor)
+	}
+	fmt.Fprintln(w)
+
+	if statx.Mask&(unix.STATX_MODE|unix.STATX_UID|unix.STATX_GID) != 0 {
+		fmt.Fprintf(w, "Access: ")
+		if statx.Mask&unix.STATX_MODE != 0 {
+			fmt.Fprintf(w, "(%04o/%s)  ", statx.Mode&07777, SymbolicMode(statx))
+		}
+		if statx.Mask&unix.STATX_UID != 0 {
+			fmt.Fprintf(w, "Uid: (%5d/%8s)   ", statx.Uid, lookupUser(statx.Uid))
+		}
+		if statx.Mask&unix.STATX_GID != 0 {
+			fmt.Fprintf(w, "Gid: (%5d/%8s)", statx.Gid, lookupGroup(statx.Gid))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if statx.Mask&unix.STATX_ATIME != 0 {
+		fmt.Fprintf(w, "Access: %s\n", timestampToTime(statx.Atime))
+	}
+	if statx.Mask&unix.STATX_MTIME != 0 {
+		fmt.Fprintf(w, "Modify: %s\n", timestampToTime(statx.Mtime))
+	}
+	if statx.Mask&unix.STATX_CTIME != 0 {
+		fmt.Fprintf(w, "Change: %s\n", timestampToTime(statx.Ctime))
+	}
+	if statx.Mask&unix.STATX_BTIME != 0 {
+		fmt.Fprintf(w, " Birth: %s\n", timestampToTime(statx.Btime))
+	}
+
+	fmt.Fprintf(w, " Attrs: %016x (%s)\n", statx.Attributes, AttrsString(statx))
+
+	if statx.Mask&unix.STATX_MNT_ID != 0 {
+		fmt.Fprintf(w, " MntID: %d\n", statx.Mnt_id)
+	}
+	if statx.Mask&unix.STATX_DIOALIGN != 0 {
+		fmt.Fprintf(w, "DioAlign: %d/%d\n", statx.Dio_mem_align, statx.Dio_offset_align)
+	}
+}
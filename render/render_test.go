@@ -0,0 +1,310 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func testStatx() *unix.Statx_t {
+	return &unix.Statx_t{
+		Mask:            unix.STATX_ALL,
+		Size:            123,
+		Blocks:          8,
+		Blksize:         4096,
+		Nlink:           1,
+		Uid:             1000,
+		Gid:             1000,
+		Mode:            unix.S_IFREG | 0644,
+		Ino:             7,
+		Attributes_mask: unix.STATX_ATTR_COMPRESSED,
+		Attributes:      unix.STATX_ATTR_COMPRESSED,
+	}
+}
+
+func render(t *testing.T, format string, newline bool, statx *unix.Statx_t) string {
+	t.Helper()
+	rr, err := Parse(format, newline)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", format, err)
+	}
+	var buf bytes.Buffer
+	rr.Render(&buf, "testfile", statx)
+	return buf.String()
+}
+
+func TestDirectives(t *testing.T) {
+	statx := testStatx()
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%n", "testfile"},
+		{"%s", "123"},
+		{"%b", "8"},
+		{"%B", "4096"},
+		{"%a", "644"},
+		{"%A", "-rw-r--r--"},
+		{"%F", "regular file"},
+		{"%h", "1"},
+		{"%i", "7"},
+		{"%u", "1000"},
+		{"%g", "1000"},
+		{"%C", "0000000000000004"},
+		{"%c", "c........"},
+		{"100%%", "100%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := render(t, tt.format, false, statx); got != tt.want {
+				t.Errorf("render(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskString(t *testing.T) {
+	if got, want := MaskString(unix.STATX_SIZE|unix.STATX_INO), "ino,size"; got != want {
+		t.Errorf("MaskString() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteIfMaskedPlaceholder(t *testing.T) {
+	statx := testStatx()
+	statx.Mask &^= unix.STATX_SIZE
+
+	if got, want := render(t, "%s", false, statx), "?"; got != want {
+		t.Errorf("render(%%s) with STATX_SIZE unset = %q, want %q", got, want)
+	}
+}
+
+func TestRenderDefaultOmitsUnsetFields(t *testing.T) {
+	statx := testStatx()
+	statx.Mask &^= unix.STATX_BTIME | unix.STATX_MNT_ID | unix.STATX_DIOALIGN
+
+	var buf bytes.Buffer
+	RenderDefault(&buf, "testfile", statx)
+	got := buf.String()
+
+	if strings.Contains(got, "?") {
+		t.Errorf("RenderDefault() with unset fields contains a \"?\" placeholder:\n%s", got)
+	}
+	for _, label := range []string{"Birth:", "MntID:", "DioAlign:"} {
+		if strings.Contains(got, label) {
+			t.Errorf("RenderDefault() with unset fields contains %q line:\n%s", label, got)
+		}
+	}
+
+	statx.Mask |= unix.STATX_BTIME | unix.STATX_MNT_ID | unix.STATX_DIOALIGN
+	buf.Reset()
+	RenderDefault(&buf, "testfile", statx)
+	got = buf.String()
+	for _, label := range []string{"Birth:", "MntID:", "DioAlign:"} {
+		if !strings.Contains(got, label) {
+			t.Errorf("RenderDefault() with fields set missing %q line:\n%s", label, got)
+		}
+	}
+}
+
+// TestRenderDefaultAgainstRealStat compares the fixed-width lines of
+// RenderDefault's output (size/inode/links/device type/uid/gid) to
+// those of GNU coreutils stat(1)'s default layout, for a regular file and
+// for /dev/null, a character special file. It is skipped when the statx(2)
+// syscall or the stat binary are unavailable; /dev/null is left out when it
+// does not exist.
+func TestRenderDefaultAgainstRealStat(t *testing.T) {
+	statBin, err := exec.LookPath("stat")
+	if err != nil {
+		t.Skip("stat(1) not found in PATH")
+	}
+
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{regular}
+	if _, err := os.Stat("/dev/null"); err == nil {
+		paths = append(paths, "/dev/null")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			var statx unix.Statx_t
+			err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_ALL, &statx)
+			if errors.Is(err, unix.ENOSYS) {
+				t.Skip("statx(2) not supported by this kernel")
+			}
+			if err != nil {
+				t.Fatalf("statx(%q): %v", path, err)
+			}
+
+			var buf bytes.Buffer
+			RenderDefault(&buf, path, &statx)
+			got := buf.String()
+
+			out, err := exec.Command(statBin, path).CombinedOutput()
+			if err != nil {
+				t.Fatalf("stat %s: %v (%s)", path, err, out)
+			}
+			want := string(out)
+
+			for _, re := range []*regexp.Regexp{
+				regexp.MustCompile(`Size: \d+ *`),
+				regexp.MustCompile(`Inode: \d+ *`),
+				regexp.MustCompile(`Links: \d+ *`),
+				regexp.MustCompile(`Device type: [0-9a-f]+,[0-9a-f]+`),
+				regexp.MustCompile(`Uid: \([^)]*\) *`),
+				regexp.MustCompile(`Gid: \([^)]*\)`),
+			} {
+				gotField, wantField := re.FindString(got), re.FindString(want)
+				if gotField != wantField {
+					t.Errorf("field matching %q = %q, want %q", re, gotField, wantField)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{`a\nb`, "a\nb"},
+		{`a\tb`, "a\tb"},
+		{`a\\b`, `a\b`},
+		{`a\x41b`, "aAb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := render(t, tt.format, false, testStatx()); got != tt.want {
+				t.Errorf("render(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{"%", `\`, "%q", `\x1`}
+	for _, format := range tests {
+		if _, err := Parse(format, false); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", format)
+		}
+	}
+}
+
+func TestNewlineFlag(t *testing.T) {
+	if got := render(t, "x", true, testStatx()); got != "x\n" {
+		t.Errorf("render with newline=true = %q, want %q", got, "x\n")
+	}
+	if got := render(t, "x", false, testStatx()); got != "x" {
+		t.Errorf("render with newline=false = %q, want %q", got, "x")
+	}
+}
+
+// TestAgainstRealStat compares our -printf output to that of GNU coreutils
+// stat(1) for a regular file, a symlink and a fifo, using a format string
+// whose directives (%s, %h, %i, %u, %g, %a, %A) have the same meaning
+// in both tools. It is skipped when the statx(2) syscall or the stat binary
+// are unavailable.
+func TestAgainstRealStat(t *testing.T) {
+	statBin, err := exec.LookPath("stat")
+	if err != nil {
+		t.Skip("stat(1) not found in PATH")
+	}
+
+	dir := t.TempDir()
+
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	symlink := filepath.Join(dir, "symlink")
+	if err := os.Symlink(regular, symlink); err != nil {
+		t.Fatal(err)
+	}
+
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const format = "%s %h %i %u %g %a %A"
+
+	for _, path := range []string{regular, symlink, fifo} {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			var statx unix.Statx_t
+			err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_ALL, &statx)
+			if errors.Is(err, unix.ENOSYS) {
+				t.Skip("statx(2) not supported by this kernel")
+			}
+			if err != nil {
+				t.Fatalf("statx(%q): %v", path, err)
+			}
+
+			got := render(t, format, false, &statx)
+
+			out, err := exec.Command(statBin, "--printf", format, path).CombinedOutput()
+			if err != nil {
+				t.Fatalf("stat --printf %q %s: %v (%s)", format, path, err, out)
+			}
+			want := strings.TrimRight(string(out), "\n")
+
+			if got != want {
+				t.Errorf("render(%q) for %s = %q, want %q (from stat(1))", format, path, got, want)
+			}
+		})
+	}
+}
+
+func TestSymbolicModeAndTypeLetter(t *testing.T) {
+	statx := testStatx()
+	statx.Mode = unix.S_IFDIR | 0755
+	if got, want := SymbolicMode(statx), "drwxr-xr-x"; got != want {
+		t.Errorf("SymbolicMode() = %q, want %q", got, want)
+	}
+	if got, want := TypeLetter(statx.Mode), byte('d'); got != want {
+		t.Errorf("TypeLetter() = %q, want %q", got, want)
+	}
+}
+
+func TestAttrsString(t *testing.T) {
+	statx := testStatx()
+	statx.Attributes_mask = unix.STATX_ATTR_COMPRESSED | unix.STATX_ATTR_IMMUTABLE
+	statx.Attributes = unix.STATX_ATTR_COMPRESSED
+
+	got := AttrsString(statx)
+	want := "c-......."
+	if got != want {
+		t.Errorf("AttrsString() = %q, want %q", got, want)
+	}
+}
+
+func TestModeOctalMatchesStrconv(t *testing.T) {
+	statx := testStatx()
+	statx.Mode = unix.S_IFREG | 0755
+	got := render(t, "%a", false, statx)
+	want := strconv.FormatUint(uint64(statx.Mode&07777), 8)
+	if got != want {
+		t.Errorf("render(%%a) = %q, want %q", got, want)
+	}
+}
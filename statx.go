@@ -16,21 +16,73 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/user"
-	"time"
+	"strings"
 
 	"golang.org/x/sys/unix"
+
+	"github.com/tklauser/statx/filter"
+	"github.com/tklauser/statx/render"
 )
 
 var (
 	noAutomount = flag.Bool("A", false, "disable automount")
 	basic       = flag.Bool("b", false, "basic stat(2) compatible stats only")
 	follow      = flag.Bool("L", false, "follow symlinks")
-	// TODO(tk): add flags for further AT_STATX_* flags and STATX_* mask
+	filterExprs filterFlag
+	or          = flag.Bool("or", false, "combine -filter expressions with OR instead of AND")
+	format      = flag.String("format", "", "use FMT instead of the default format, followed by a newline")
+	printfFmt   = flag.String("printf", "", "like -format, but do not append a newline")
+	sync        = flag.String("sync", "", "synchronization to use: as-stat, force or dont (see AT_STATX_SYNC_* in statx(2))")
+	maskFlag    = flag.String("mask", "", "comma-separated list of STATX_* mask bits to request instead of the default (see statx(2))")
 )
 
-func statxTimestampToTime(sts unix.StatxTimestamp) time.Time {
-	return time.Unix(sts.Sec, int64(sts.Nsec))
+// maskNames maps the symbolic names accepted by -mask to the mask bits (or
+// combination of bits) they request.
+var maskNames = map[string]uint32{
+	"type":     unix.STATX_TYPE,
+	"mode":     unix.STATX_MODE,
+	"nlink":    unix.STATX_NLINK,
+	"uid":      unix.STATX_UID,
+	"gid":      unix.STATX_GID,
+	"atime":    unix.STATX_ATIME,
+	"mtime":    unix.STATX_MTIME,
+	"ctime":    unix.STATX_CTIME,
+	"btime":    unix.STATX_BTIME,
+	"ino":      unix.STATX_INO,
+	"size":     unix.STATX_SIZE,
+	"blocks":   unix.STATX_BLOCKS,
+	"mnt_id":   unix.STATX_MNT_ID,
+	"dioalign": unix.STATX_DIOALIGN,
+	"all":      unix.STATX_ALL,
+	"basic":    unix.STATX_BASIC_STATS,
+}
+
+// parseMask ORs together the mask bits named by the comma-separated list s.
+func parseMask(s string) (uint32, error) {
+	var mask uint32
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		bit, ok := maskNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown mask name %q", name)
+		}
+		mask |= bit
+	}
+	return mask, nil
+}
+
+// filterFlag collects the values of repeated -filter flags.
+type filterFlag []string
+
+func (f *filterFlag) String() string { return "" }
+
+func (f *filterFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func init() {
+	flag.Var(&filterExprs, "filter", "filter files by statx field, e.g. 'size>1M' (repeatable, combined with AND unless -or is given); prefix an expression with ! to negate it (the per-expression equivalent of -not)")
 }
 
 func main() {
@@ -43,7 +95,7 @@ func main() {
 	}
 
 	flags := unix.AT_SYMLINK_NOFOLLOW
-	mask := unix.STATX_ALL
+	mask := unix.STATX_ALL | unix.STATX_MNT_ID | unix.STATX_DIOALIGN
 
 	if *noAutomount {
 		flags |= unix.AT_NO_AUTOMOUNT
@@ -51,10 +103,43 @@ func main() {
 	if *basic {
 		mask = unix.STATX_BASIC_STATS
 	}
+	if *maskFlag != "" {
+		m, err := parseMask(*maskFlag)
+		if err != nil {
+			log.Fatalf("invalid -mask value: %v", err)
+		}
+		mask = int(m)
+	}
 	if *follow {
 		flags &^= unix.AT_SYMLINK_NOFOLLOW
 	}
+	switch *sync {
+	case "":
+	case "as-stat":
+		flags |= unix.AT_STATX_SYNC_AS_STAT
+	case "force":
+		flags |= unix.AT_STATX_FORCE_SYNC
+	case "dont":
+		flags |= unix.AT_STATX_DONT_SYNC
+	default:
+		log.Fatalf("invalid -sync value %q, want as-stat, force or dont", *sync)
+	}
+
+	predicates := make([]filter.Predicate, len(filterExprs))
+	for i, expr := range filterExprs {
+		p, err := filter.Parse(expr)
+		if err != nil {
+			log.Fatalf("invalid -filter expression %q: %v", expr, err)
+		}
+		predicates[i] = p
+	}
 
+	rr, err := renderer()
+	if err != nil {
+		log.Fatalf("invalid format: %v", err)
+	}
+
+	nmatched := 0
 	for _, arg := range flag.Args() {
 		var statx unix.Statx_t
 		if err := unix.Statx(unix.AT_FDCWD, arg, flags, mask, &statx); err != nil {
@@ -63,153 +148,62 @@ func main() {
 			}
 			log.Fatalf("cannot statx '%s': %v", arg, err)
 		}
-		fmt.Printf("  File: '%s'\n", arg)
 
-		fmt.Print(" ")
-		if statx.Mask&unix.STATX_SIZE != 0 {
-			fmt.Printf(" Size: %-15d", statx.Size)
-		}
-		if statx.Mask&unix.STATX_BLOCKS != 0 {
-			fmt.Printf(" Blocks: %-10d", statx.Blocks)
+		if !matches(predicates, *or, &statx) {
+			continue
 		}
-		fmt.Printf(" IO Block: %-6d", statx.Blksize)
-		ft := '?'
-		if statx.Mask&unix.STATX_TYPE != 0 {
-			switch statx.Mode & unix.S_IFMT {
-			case unix.S_IFIFO:
-				fmt.Print(" FIFO")
-				ft = 'p'
-			case unix.S_IFCHR:
-				fmt.Print(" character special file")
-				ft = 'c'
-			case unix.S_IFDIR:
-				fmt.Print(" directory")
-				ft = 'd'
-			case unix.S_IFBLK:
-				fmt.Print(" block special file")
-				ft = 'b'
-			case unix.S_IFREG:
-				fmt.Print(" regular file")
-				ft = '-'
-			case unix.S_IFLNK:
-				fmt.Print(" symbolic link")
-				ft = 'l'
-			case unix.S_IFSOCK:
-				fmt.Print(" socket")
-				ft = 's'
-			default:
-				fmt.Printf(" unknown type (%o)", statx.Mode&unix.S_IFMT)
-			}
-		} else {
-			fmt.Printf(" no type")
-		}
-		fmt.Println()
+		nmatched++
 
-		dev := unix.Mkdev(statx.Dev_major, statx.Dev_minor)
-		fmt.Printf("Device: %-15s", fmt.Sprintf("%xh/%dd", dev, dev))
-		if statx.Mask&unix.STATX_INO != 0 {
-			fmt.Printf(" Inode: %-11d", statx.Ino)
-		}
-		if statx.Mask&unix.STATX_NLINK != 0 {
-			fmt.Printf(" Links: %-5d", statx.Nlink)
-		}
-		if statx.Mask&unix.STATX_TYPE != 0 {
-			switch statx.Mode & unix.S_IFMT {
-			case unix.S_IFBLK:
-				fallthrough
-			case unix.S_IFCHR:
-				fmt.Printf(" Device type: %d,%d", statx.Rdev_major, statx.Rdev_minor)
-				break
-			}
-		}
-		fmt.Println()
+		rr(os.Stdout, arg, &statx)
+	}
 
-		if statx.Mask&unix.STATX_MODE != 0 {
-			u := []byte{'-', '-', '-'}
-			if statx.Mode&unix.S_IRUSR != 0 {
-				u[0] = 'r'
-			}
-			if statx.Mode&unix.S_IWUSR != 0 {
-				u[1] = 'w'
-			}
-			if statx.Mode&unix.S_IXUSR != 0 {
-				u[2] = 'x'
-			}
-			g := []byte{'-', '-', '-'}
-			if statx.Mode&unix.S_IRGRP != 0 {
-				g[0] = 'r'
-			}
-			if statx.Mode&unix.S_IWGRP != 0 {
-				g[1] = 'w'
-			}
-			if statx.Mode&unix.S_IXGRP != 0 {
-				g[2] = 'x'
-			}
-			o := []byte{'-', '-', '-'}
-			if statx.Mode&unix.S_IROTH != 0 {
-				o[0] = 'r'
-			}
-			if statx.Mode&unix.S_IWOTH != 0 {
-				o[1] = 'w'
-			}
-			if statx.Mode&unix.S_IXOTH != 0 {
-				o[2] = 'x'
-			}
-			fmt.Printf("Access: (%04o/%c%s%s%s)  ", statx.Mode&07777, ft, u, g, o)
-		}
-		if statx.Mask&unix.STATX_UID != 0 {
-			user, err := user.LookupId(fmt.Sprint(statx.Uid))
-			if err == nil {
-				fmt.Printf("Uid: (%5d/%8s)   ", statx.Uid, user.Username)
-			} else {
-				fmt.Printf("Uid: %5d   ", statx.Uid)
-			}
-		}
-		if statx.Mask&unix.STATX_GID != 0 {
-			group, err := user.LookupGroupId(fmt.Sprint(statx.Gid))
-			if err == nil {
-				fmt.Printf("Gid: (%5d/%8s)", statx.Gid, group.Name)
-			} else {
-				fmt.Printf("Gid: %5d", statx.Gid)
-			}
-		}
-		fmt.Println()
+	if len(predicates) > 0 && nmatched == 0 {
+		os.Exit(1)
+	}
+}
 
-		if statx.Mask&unix.STATX_ATIME != 0 {
-			fmt.Println("Access:", statxTimestampToTime(statx.Atime))
-		}
-		if statx.Mask&unix.STATX_MTIME != 0 {
-			fmt.Println("Modify:", statxTimestampToTime(statx.Mtime))
-		}
-		if statx.Mask&unix.STATX_CTIME != 0 {
-			fmt.Println("Change:", statxTimestampToTime(statx.Ctime))
+// renderer builds the render.RenderFunc to use for the output, based on the
+// -format and -printf flags, falling back to render.RenderDefault when
+// neither is given.
+func renderer() (render.RenderFunc, error) {
+	switch {
+	case *format != "" && *printfFmt != "":
+		log.Fatal("only one of -format or -printf may be given")
+	case *format != "":
+		rr, err := render.Parse(*format, true)
+		if err != nil {
+			return nil, err
 		}
-		if statx.Mask&unix.STATX_BTIME != 0 {
-			fmt.Println(" Birth:", statxTimestampToTime(statx.Btime))
+		return rr.Render, nil
+	case *printfFmt != "":
+		rr, err := render.Parse(*printfFmt, false)
+		if err != nil {
+			return nil, err
 		}
+		return rr.Render, nil
+	}
+	return render.RenderDefault, nil
+}
 
-		if statx.Attributes_mask != 0 {
-			fmt.Printf(" Attrs: %016x (", statx.Attributes)
-			attrs := []struct {
-				attr string
-				mask uint64
-			}{
-				{"c", unix.STATX_ATTR_COMPRESSED}, // file is compressed by the fs
-				{"i", unix.STATX_ATTR_IMMUTABLE},  // file is marked immutable
-				{"a", unix.STATX_ATTR_APPEND},     // file is append-only
-				{"d", unix.STATX_ATTR_NODUMP},     // file is not to be dumped
-				{"e", unix.STATX_ATTR_ENCRYPTED},  // file requires key to decrypt in fs
-			}
-			for _, a := range attrs {
-				if statx.Attributes_mask&a.mask == 0 {
-					fmt.Print(".") // not supported
-				} else if statx.Attributes&a.mask != 0 {
-					fmt.Print(a.attr)
-				} else {
-					fmt.Print("-") // not set
-				}
+// matches reports whether statx satisfies predicates, combined with AND
+// unless or is set, in which case they are combined with OR. An empty
+// predicates slice always matches.
+func matches(predicates []filter.Predicate, or bool, statx *unix.Statx_t) bool {
+	if len(predicates) == 0 {
+		return true
+	}
+	if or {
+		for _, p := range predicates {
+			if p.Eval(statx) {
+				return true
 			}
-			fmt.Println(")")
+		}
+		return false
+	}
+	for _, p := range predicates {
+		if !p.Eval(statx) {
+			return false
 		}
 	}
+	return true
 }
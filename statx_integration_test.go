@@ -0,0 +1,66 @@
+// Copyright 2018 Tobias Klauser. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestStatxIntegration exercises the real statx(2) syscall and checks that
+// STATX_BASIC_STATS bits are reported and that STATX_MNT_ID is reported on
+// Linux 5.8 and newer. For STATX_DIOALIGN (Linux 6.1 and newer) it only logs
+// whether the bit is set, since not every filesystem supplies it. It skips
+// entirely on kernels older than 4.11, which don't have statx(2) at all.
+func TestStatxIntegration(t *testing.T) {
+	kv, err := currentKernelVersion()
+	if err != nil {
+		t.Skipf("could not determine kernel version: %v", err)
+	}
+	if !kv.atLeast(4, 11) {
+		t.Skipf("kernel %+v predates statx(2) (needs >= 4.11)", kv)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "testfile")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var statx unix.Statx_t
+	mask := unix.STATX_ALL | unix.STATX_MNT_ID | unix.STATX_DIOALIGN
+	err = unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, mask, &statx)
+	if err == unix.ENOSYS {
+		t.Skip("statx(2) not supported by this kernel")
+	}
+	if err != nil {
+		t.Fatalf("statx(%q): %v", path, err)
+	}
+
+	if statx.Mask&unix.STATX_BASIC_STATS == 0 {
+		t.Errorf("statx.Mask = %#x, want STATX_BASIC_STATS bits set", statx.Mask)
+	}
+
+	if kv.atLeast(5, 8) {
+		if statx.Mask&unix.STATX_MNT_ID == 0 {
+			t.Errorf("statx.Mask = %#x, want STATX_MNT_ID set on kernel %+v", statx.Mask, kv)
+		}
+	} else {
+		t.Logf("kernel %+v predates STATX_MNT_ID (needs >= 5.8), skipping that check", kv)
+	}
+
+	if kv.atLeast(6, 1) {
+		if statx.Mask&unix.STATX_DIOALIGN == 0 {
+			t.Logf("statx.Mask = %#x: STATX_DIOALIGN not set on kernel %+v (fs may not support it)", statx.Mask, kv)
+		}
+	} else {
+		t.Logf("kernel %+v predates STATX_DIOALIGN (needs >= 6.1), skipping that check", kv)
+	}
+}